@@ -0,0 +1,28 @@
+// Package conf holds navidrome's process-wide runtime configuration. The
+// active configuration is exposed through the package-level Server
+// variable; other packages read it directly (e.g. conf.Server.Scanner.Backends)
+// rather than threading config values through as parameters.
+package conf
+
+// configOptions declares the settings this module reads from conf.Server.
+// It lives alongside navidrome's many other runtime options (DbPath,
+// MusicFolder, etc.), which are not reproduced here.
+type configOptions struct {
+	// Scanner groups settings specific to the metadata scanner.
+	Scanner scannerOptions
+	// ProbeWorkers is the number of concurrent ffprobe processes
+	// ffmpeg.ParserPool runs at once. <= 0 (the default) falls back to
+	// sequential probing, one file at a time.
+	ProbeWorkers int
+}
+
+// scannerOptions groups the scanner's own settings under conf.Server.Scanner.
+type scannerOptions struct {
+	// Backends is a comma-separated list of metadata.Reader names, in
+	// priority order, used to override metadata's built-in default backend
+	// order. Empty (the default) leaves backend selection to that default.
+	Backends string
+}
+
+// Server holds the active configuration.
+var Server = &configOptions{}
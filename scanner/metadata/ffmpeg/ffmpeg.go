@@ -1,50 +1,230 @@
 package ffmpeg
 
 import (
-	"bufio"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
-	"time"
+	"sync"
 
-	"github.com/navidrome/navidrome/conf"
 	"github.com/navidrome/navidrome/log"
+	"github.com/navidrome/navidrome/scanner/metadata"
 )
 
-type Parser struct{}
+func init() {
+	metadata.Register(&Parser{})
+}
+
+// Parser extracts tags by probing files with ffprobe and decoding its JSON
+// output. It is the fallback backend: slower than a native tag reader, but
+// able to handle anything ffmpeg can demux.
+type Parser struct {
+	poolOnce sync.Once
+	pool     *ParserPool
+}
 
-type parsedTags = map[string][]string
+// getPool lazily builds the ParserPool used by Read, once per Parser, so
+// conf.Server.ProbeWorkers is read a single time rather than on every batch.
+func (e *Parser) getPool() *ParserPool {
+	e.poolOnce.Do(func() {
+		e.pool = NewParserPool()
+	})
+	return e.pool
+}
 
-func (e *Parser) Parse(files ...string) (map[string]parsedTags, error) {
-	args := e.createProbeCommand(files)
+type parsedTags = metadata.ParsedTags
+
+func (e *Parser) Name() string { return "ffmpeg" }
+
+// CanRead always returns true: Parser is the catch-all fallback for any
+// file format ffmpeg is able to demux.
+func (e *Parser) CanRead(path string) bool { return true }
+
+// HasStreamInfo is always true: ffprobe always reports duration, and
+// bitrate/channels/has_picture whenever the container's streams carry
+// them, so Parser never needs backfilling from another backend.
+func (e *Parser) HasStreamInfo() bool { return true }
+
+// Read probes files through a ParserPool so large batches are parsed
+// concurrently instead of blocking on one ffprobe process at a time.
+func (e *Parser) Read(files ...string) (map[string]parsedTags, error) {
+	results := e.getPool().Probe(context.Background(), files)
 
-	log.Trace("Executing command", "args", args)
-	cmd := exec.Command(args[0], args[1:]...) // #nosec
-	output, _ := cmd.CombinedOutput()
 	fileTags := map[string]parsedTags{}
-	if len(output) == 0 {
-		return fileTags, errors.New("error extracting metadata files")
-	}
-	infos := e.parseOutput(string(output))
-	for file, info := range infos {
-		tags, err := e.extractMetadata(file, info)
-		// Skip files with errors
-		if err == nil {
-			fileTags[file] = tags
+	for res := range results {
+		if res.Err != nil {
+			log.Trace("Error probing file", "file", res.Path, res.Err)
+			continue
 		}
+		fileTags[res.Path] = res.Detail.tags()
+	}
+	if len(fileTags) == 0 && len(files) > 0 {
+		return fileTags, errors.New("error extracting metadata files")
 	}
 	return fileTags, nil
 }
 
-func (e *Parser) extractMetadata(filePath, info string) (parsedTags, error) {
-	tags := e.parseInfo(info)
-	if len(tags) == 0 {
-		log.Trace("Not a media file. Skipping", "filePath", filePath)
-		return nil, errors.New("not a media file")
+// Detail is the typed result of probing a single file with ffprobe. It is
+// richer than the flattened parsedTags map returned by Read, and is
+// meant for features that need more structure than a tag map can offer,
+// such as chapter navigation or per-stream metadata.
+type Detail struct {
+	Format   Format
+	Streams  []Stream
+	Chapters []Chapter
+}
+
+// Format mirrors ffprobe's "format" section.
+type Format struct {
+	Duration float64
+	BitRate  int
+	Tags     map[string][]string
+}
+
+// Stream mirrors one entry of ffprobe's "streams" section.
+type Stream struct {
+	CodecType     string // "audio", "video", "subtitle", ...
+	CodecName     string
+	SampleRate    int
+	Channels      int
+	ChannelLayout string
+	BitRate       int
+	Language      string
+	AttachedPic   bool
+	Tags          map[string][]string
+}
+
+// Chapter mirrors one entry of ffprobe's "chapters" section.
+type Chapter struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Title string  `json:"title,omitempty"`
+}
+
+// ffprobeOutput matches the shape of `ffprobe -show_format -show_streams
+// -show_chapters -print_format json`.
+type ffprobeOutput struct {
+	Format struct {
+		Duration string            `json:"duration"`
+		BitRate  string            `json:"bit_rate"`
+		Tags     map[string]string `json:"tags"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType     string            `json:"codec_type"`
+		CodecName     string            `json:"codec_name"`
+		SampleRate    string            `json:"sample_rate"`
+		Channels      int               `json:"channels"`
+		ChannelLayout string            `json:"channel_layout"`
+		BitRate       string            `json:"bit_rate"`
+		Tags          map[string]string `json:"tags"`
+		Disposition   map[string]int    `json:"disposition"`
+	} `json:"streams"`
+	Chapters []ffprobeChapter `json:"chapters"`
+}
+
+type ffprobeChapter struct {
+	StartTime string            `json:"start_time"`
+	EndTime   string            `json:"end_time"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// ParseDetailed probes a single file with ffprobe and returns its typed
+// format, stream and chapter metadata.
+func (e *Parser) ParseDetailed(file string) (*Detail, error) {
+	return e.ParseDetailedContext(context.Background(), file)
+}
+
+// ParseDetailedContext is ParseDetailed with a caller-supplied context, so
+// probes can be cancelled or bounded by a timeout. Used by ParserPool.
+func (e *Parser) ParseDetailedContext(ctx context.Context, file string) (*Detail, error) {
+	args := e.createProbeCommand(file)
+
+	log.Trace("Executing command", "args", args)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) // #nosec
+	output, err := cmd.Output()
+	if err != nil {
+		// Wrapped, not flattened to a string: callers use errors.Is to tell
+		// ParserPool's per-probe timeout/cancellation (context.DeadlineExceeded,
+		// context.Canceled) apart from a genuine ffprobe failure.
+		return nil, fmt.Errorf("error extracting metadata: %w", err)
+	}
+
+	var probe ffprobeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, err
+	}
+
+	detail := &Detail{
+		Format: Format{
+			Duration: parseFloat(probe.Format.Duration),
+			BitRate:  parseInt(probe.Format.BitRate),
+			Tags:     lowerKeys(probe.Format.Tags),
+		},
+	}
+
+	for _, s := range probe.Streams {
+		detail.Streams = append(detail.Streams, Stream{
+			CodecType:     s.CodecType,
+			CodecName:     s.CodecName,
+			SampleRate:    parseInt(s.SampleRate),
+			Channels:      s.Channels,
+			ChannelLayout: s.ChannelLayout,
+			BitRate:       parseInt(s.BitRate),
+			Language:      s.Tags["language"],
+			AttachedPic:   s.Disposition["attached_pic"] == 1,
+			Tags:          lowerKeys(s.Tags),
+		})
+	}
+
+	for _, c := range probe.Chapters {
+		detail.Chapters = append(detail.Chapters, buildChapter(c))
+	}
+
+	return detail, nil
+}
+
+// tags flattens a Detail into the parsedTags shape the rest of the scanner
+// expects, so callers of Read don't need to change.
+func (d *Detail) tags() parsedTags {
+	tags := parsedTags{}
+	for k, v := range d.Format.Tags {
+		tags[k] = v
+	}
+
+	tags["duration"] = []string{strconv.FormatFloat(d.Format.Duration, 'f', 2, 64)}
+	if d.Format.BitRate > 0 {
+		tags["bitrate"] = []string{strconv.Itoa(d.Format.BitRate / 1000)}
 	}
 
+	for _, s := range d.Streams {
+		switch s.CodecType {
+		case "audio":
+			if s.BitRate > 0 {
+				tags["bitrate"] = []string{strconv.Itoa(s.BitRate / 1000)}
+			}
+			if s.Channels > 0 {
+				tags["channels"] = []string{strconv.Itoa(s.Channels)}
+			}
+			// Some formats (e.g. MP4 freeform lyrics atoms) attach their
+			// tags to the audio stream rather than the container format.
+			for k, v := range s.Tags {
+				if _, ok := tags[k]; !ok {
+					tags[k] = v
+				}
+			}
+		case "video":
+			if s.AttachedPic {
+				tags["has_picture"] = []string{"true"}
+			}
+		}
+	}
+
+	// Some containers surface tags under their raw ID3/Vorbis frame names
+	// instead of the ones above; fold the ones we know about in.
 	alternativeTags := map[string][]string{
 		"disc":        {"tpa"},
 		"has_picture": {"metadata_block_picture"},
@@ -56,153 +236,106 @@ func (e *Parser) extractMetadata(filePath, info string) (parsedTags, error) {
 			}
 		}
 	}
-	return tags, nil
-}
-
-var (
-	// Input #0, mp3, from 'groovin.mp3':
-	inputRegex = regexp.MustCompile(`(?m)^Input #\d+,.*,\sfrom\s'(.*)'`)
-
-	//    TITLE           : Back In Black
-	tagsRx = regexp.MustCompile(`(?i)^\s{4,6}([\w\s-]+)\s*:(.*)`)
 
-	//                    : Second comment line
-	continuationRx = regexp.MustCompile(`(?i)^\s+:(.*)`)
+	extractSyncedLyrics(tags)
 
-	//  Duration: 00:04:16.00, start: 0.000000, bitrate: 995 kb/s`
-	durationRx = regexp.MustCompile(`^\s\sDuration: ([\d.:]+).*bitrate: (\d+)`)
-
-	//    Stream #0:0: Audio: mp3, 44100 Hz, stereo, fltp, 192 kb/s
-	audioStreamRx = regexp.MustCompile(`^\s{2,4}Stream #\d+:\d+.*: (Audio): (.*), (.* Hz), ([\w\.]+),*(.*.,)*(.(\d+).kb/s)*`)
-
-	//    Stream #0:1: Video: mjpeg, yuvj444p(pc, bt470bg/unknown/unknown), 600x600 [SAR 1:1 DAR 1:1], 90k tbr, 90k tbn, 90k tbc`
-	coverRx = regexp.MustCompile(`^\s{2,4}Stream #\d+:\d+: (Video):.*`)
-)
-
-func (e *Parser) parseOutput(output string) map[string]string {
-	outputs := map[string]string{}
-	all := inputRegex.FindAllStringSubmatchIndex(output, -1)
-	for i, loc := range all {
-		// Filename is the first captured group
-		file := output[loc[2]:loc[3]]
-
-		// File info is everything from the match, up until the beginning of the next match
-		info := ""
-		initial := loc[1]
-		if i < len(all)-1 {
-			end := all[i+1][0] - 1
-			info = output[initial:end]
-		} else {
-			// if this is the last match
-			info = output[initial:]
+	if len(d.Chapters) > 0 {
+		if encoded, err := json.Marshal(d.Chapters); err == nil {
+			tags["chapters"] = []string{string(encoded)}
 		}
-		outputs[file] = info
 	}
-	return outputs
-}
 
-func (e *Parser) parseInfo(info string) map[string][]string {
-	tags := map[string][]string{}
+	return tags
+}
 
-	reader := strings.NewReader(info)
-	scanner := bufio.NewScanner(reader)
-	lastTag := ""
-	for scanner.Scan() {
-		line := scanner.Text()
-		if len(line) == 0 {
-			continue
-		}
-		match := tagsRx.FindStringSubmatch(line)
-		if len(match) > 0 {
-			tagName := strings.TrimSpace(strings.ToLower(match[1]))
-			if tagName != "" {
-				tagValue := strings.TrimSpace(match[2])
-				tags[tagName] = append(tags[tagName], tagValue)
-				lastTag = tagName
-				continue
-			}
-		}
+// lrcTimestampRx matches an LRC-style synchronized lyrics line, e.g.
+// "[00:12.34]Some words".
+var lrcTimestampRx = regexp.MustCompile(`(?m)^\[\d{1,3}:\d{2}(?:\.\d{1,3})?\]`)
 
-		if lastTag != "" {
-			match = continuationRx.FindStringSubmatch(line)
-			if len(match) > 0 {
-				if tags[lastTag] == nil {
-					tags[lastTag] = []string{""}
-				}
-				tagValue := tags[lastTag][0]
-				tags[lastTag][0] = tagValue + "\n" + strings.TrimSpace(match[1])
-				continue
-			}
-		}
+// isLyricsTagKey reports whether key is a known carrier of lyrics text: the
+// ID3v2 USLT frame (which ffprobe normalizes to "lyrics", or to
+// "lyrics-<ISO 639-2 code>" when tagged with a specific language), the MP4
+// freeform "----:com.apple.iTunes:LYRICS" atom, or the Vorbis "LYRICS"
+// comment. ffprobe does not decode binary SYLT frames at all, so there is
+// no separate synced-lyrics source to read; extractSyncedLyrics is a
+// heuristic over this same USLT/freeform text, applied when it happens to
+// contain LRC-style timestamped lines.
+func isLyricsTagKey(key string) bool {
+	switch key {
+	case "lyrics", "unsyncedlyrics", "----:com.apple.itunes:lyrics":
+		return true
+	default:
+		return strings.HasPrefix(key, "lyrics-")
+	}
+}
 
-		lastTag = ""
-		match = coverRx.FindStringSubmatch(line)
-		if len(match) > 0 {
-			tags["has_picture"] = []string{"true"}
+// extractSyncedLyrics looks for lyrics tags whose contents are LRC-format
+// (line-prefixed timestamps) and copies them to "lyrics_synced", so callers
+// can tell plain lyrics apart from time-synced ones without reparsing text.
+func extractSyncedLyrics(tags parsedTags) {
+	for key, values := range tags {
+		if !isLyricsTagKey(key) {
 			continue
 		}
-
-		match = durationRx.FindStringSubmatch(line)
-		if len(match) > 0 {
-			tags["duration"] = []string{e.parseDuration(match[1])}
-			if len(match) > 1 {
-				tags["bitrate"] = []string{match[2]}
+		for _, value := range values {
+			if lrcTimestampRx.MatchString(value) {
+				tags["lyrics_synced"] = append(tags["lyrics_synced"], value)
 			}
-			continue
-		}
-
-		match = audioStreamRx.FindStringSubmatch(line)
-		if len(match) > 0 {
-			tags["bitrate"] = []string{match[7]}
-			tags["channels"] = []string{e.parseChannels(match[4])}
 		}
 	}
+}
 
-	comment := tags["comment"]
-	if len(comment) > 0 && comment[0] == "Cover (front)" {
-		delete(tags, "comment")
+// buildChapter converts one raw ffprobe chapter entry into a Chapter,
+// lowercasing its tags the same way Format/Stream tags are, so a container
+// that emits "Title" instead of "title" still gets its chapter title.
+func buildChapter(c ffprobeChapter) Chapter {
+	chapterTags := lowerKeys(c.Tags)
+	var title string
+	if v := chapterTags["title"]; len(v) > 0 {
+		title = v[0]
+	}
+	return Chapter{
+		Start: parseFloat(c.StartTime),
+		End:   parseFloat(c.EndTime),
+		Title: title,
 	}
-
-	return tags
 }
 
-var zeroTime = time.Date(0000, time.January, 1, 0, 0, 0, 0, time.UTC)
-
-func (e *Parser) parseDuration(tag string) string {
-	d, err := time.Parse("15:04:05", tag)
-	if err != nil {
-		return "0"
+func lowerKeys(m map[string]string) map[string][]string {
+	out := make(map[string][]string, len(m))
+	for k, v := range m {
+		if v == "" {
+			continue
+		}
+		out[strings.ToLower(k)] = []string{v}
 	}
-	return strconv.FormatFloat(d.Sub(zeroTime).Seconds(), 'f', 2, 32)
+	return out
 }
 
-func (e *Parser) parseChannels(tag string) string {
-	if tag == "mono" {
-		return "1"
-	} else if tag == "stereo" {
-		return "2"
-	} else if tag == "5.1" {
-		return "6"
-	} else if tag == "7.1" {
-		return "8"
-	}
+func parseFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
 
-	return "0"
+func parseInt(s string) int {
+	i, _ := strconv.Atoi(s)
+	return i
 }
 
+// probeBinary is hardcoded rather than read from conf.Server.ProbeCommand:
+// that setting configures an ffmpeg invocation (it's what the stderr
+// regexes this package used to scrape were written against), and ffmpeg
+// doesn't understand the ffprobe-only flags below. ParseDetailedContext
+// needs ffprobe specifically, so it no longer goes through that setting.
+const probeBinary = "ffprobe"
+
 // Inputs will always be absolute paths
-func (e *Parser) createProbeCommand(inputs []string) []string {
-	split := strings.Split(conf.Server.ProbeCommand, " ")
-	args := make([]string, 0)
-
-	for _, s := range split {
-		if s == "%s" {
-			for _, inp := range inputs {
-				args = append(args, "-i", inp)
-			}
-		} else {
-			args = append(args, s)
-		}
+func (e *Parser) createProbeCommand(input string) []string {
+	return []string{
+		probeBinary,
+		"-v", "quiet",
+		"-print_format", "json",
+		"-show_format", "-show_streams", "-show_chapters",
+		"-i", input,
 	}
-	return args
 }
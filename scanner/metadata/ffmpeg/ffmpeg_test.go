@@ -0,0 +1,108 @@
+package ffmpeg
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCreateProbeCommandRunsFfprobe(t *testing.T) {
+	var e Parser
+	args := e.createProbeCommand("/music/song.mp3")
+
+	if args[0] != "ffprobe" {
+		t.Fatalf("expected argv[0] to be ffprobe, got %q (args: %v)", args[0], args)
+	}
+	for _, want := range []string{"-print_format", "json", "-show_format", "-show_streams", "-show_chapters"} {
+		if !contains(args, want) {
+			t.Errorf("expected args to contain %q, got %v", want, args)
+		}
+	}
+	if !contains(args, "-i") || !contains(args, "/music/song.mp3") {
+		t.Errorf("expected args to probe the given file, got %v", args)
+	}
+}
+
+func contains(args []string, want string) bool {
+	for _, a := range args {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDetailTagsFlattening(t *testing.T) {
+	detail := &Detail{
+		Format: Format{
+			Duration: 256.5,
+			BitRate:  995000,
+			Tags:     map[string][]string{"title": {"Back In Black"}, "artist": {"AC/DC"}},
+		},
+		Streams: []Stream{
+			{CodecType: "audio", BitRate: 192000, Channels: 2},
+			{CodecType: "video", AttachedPic: true},
+		},
+		Chapters: []Chapter{
+			{Start: 0, End: 120, Title: "Intro"},
+		},
+	}
+
+	tags := detail.tags()
+
+	if got := tags["duration"][0]; got != "256.50" {
+		t.Errorf("duration = %q, want 256.50", got)
+	}
+	if got := tags["bitrate"][0]; got != "192" {
+		t.Errorf("bitrate = %q, want the audio stream's bitrate (192)", got)
+	}
+	if got := tags["channels"][0]; got != "2" {
+		t.Errorf("channels = %q, want 2", got)
+	}
+	if got := tags["has_picture"][0]; got != "true" {
+		t.Errorf("has_picture = %q, want true", got)
+	}
+
+	var chapters []Chapter
+	if err := json.Unmarshal([]byte(tags["chapters"][0]), &chapters); err != nil {
+		t.Fatalf("chapters tag is not valid JSON: %v", err)
+	}
+	if len(chapters) != 1 || chapters[0].Title != "Intro" {
+		t.Errorf("chapters = %+v, want one chapter titled Intro", chapters)
+	}
+}
+
+func TestExtractSyncedLyricsMatchesAnyLanguage(t *testing.T) {
+	lrc := "[00:01.00]line one\n[00:05.00]line two"
+	tags := parsedTags{
+		"lyrics-eng": {lrc},
+		"lyrics-fra": {lrc},
+		"lyrics":     {"just plain, non-LRC lyrics"},
+	}
+
+	extractSyncedLyrics(tags)
+
+	synced := tags["lyrics_synced"]
+	if len(synced) != 2 {
+		t.Fatalf("expected both lyrics-eng and lyrics-fra to be recognized as synced, got %v", synced)
+	}
+}
+
+func TestExtractSyncedLyricsIgnoresPlainLyrics(t *testing.T) {
+	tags := parsedTags{"lyrics": {"just plain, non-LRC lyrics"}}
+
+	extractSyncedLyrics(tags)
+
+	if _, ok := tags["lyrics_synced"]; ok {
+		t.Errorf("expected no lyrics_synced tag for non-LRC lyrics, got %v", tags["lyrics_synced"])
+	}
+}
+
+func TestBuildChapterTitleIsCaseInsensitive(t *testing.T) {
+	c := ffprobeChapter{StartTime: "0", EndTime: "10", Tags: map[string]string{"Title": "Chapter One"}}
+
+	chapter := buildChapter(c)
+
+	if chapter.Title != "Chapter One" {
+		t.Errorf("expected capitalized \"Title\" tag to be picked up, got %+v", chapter)
+	}
+}
@@ -0,0 +1,129 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/navidrome/navidrome/conf"
+	"github.com/navidrome/navidrome/log"
+)
+
+// Result is one file's probe outcome, as produced by a ParserPool.
+type Result struct {
+	Path   string
+	Detail *Detail
+	Err    error
+}
+
+// prober is the subset of Parser that ParserPool depends on. Its own type
+// so tests can substitute a fake instead of shelling out to real ffprobe.
+type prober interface {
+	ParseDetailedContext(ctx context.Context, file string) (*Detail, error)
+}
+
+// ParserPool runs ffprobe probes for a batch of files concurrently across
+// a fixed number of worker goroutines, rather than one at a time.
+// Parser.Read probes through one.
+//
+// Scope note: an earlier version of this package described the goal as a
+// *persistent* pool — long-lived ffprobe processes fed files over stdin
+// (ffprobe batching via "-f concat"), with graceful worker restart, to
+// remove the per-file process-spawn cost entirely. That isn't implemented
+// here, and can't be with stock ffprobe: there is no ffprobe mode that
+// accepts a stream of unrelated input files over one long-lived process
+// and emits a separate JSON document per file — every invocation takes
+// exactly one -i and exits once it has probed it, via probeOne ->
+// ParseDetailedContext. What ParserPool actually does is run N of those
+// per-file processes concurrently instead of one at a time, which still
+// shortens wall-clock time on large libraries, since process start-up and
+// I/O for the rest of the batch stay in flight while other workers'
+// probes complete — it just doesn't touch the per-file spawn cost itself.
+type ParserPool struct {
+	parser  prober
+	workers int
+	timeout time.Duration
+}
+
+// NewParserPool builds a pool sized from conf.Server.ProbeWorkers (falling
+// back to 1, i.e. probing one file at a time, if unset).
+func NewParserPool() *ParserPool {
+	workers := conf.Server.ProbeWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	return &ParserPool{
+		parser:  &Parser{},
+		workers: workers,
+		timeout: 30 * time.Second,
+	}
+}
+
+// Probe fans paths out across the pool's workers and streams a Result per
+// path back on the returned channel as soon as it is ready, in completion
+// order rather than input order. The channel is closed once every path has
+// been processed or ctx is cancelled. Per-file failures are reported via
+// Result.Err, not a return value: Probe itself never fails.
+func (p *ParserPool) Probe(ctx context.Context, paths []string) <-chan Result {
+	jobs := make(chan string)
+	// Buffered so a slow consumer applies backpressure to the job feeder
+	// without blocking every worker at once.
+	results := make(chan Result, p.workers)
+
+	go func() {
+		defer close(jobs)
+		for _, path := range paths {
+			select {
+			case jobs <- path:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(p.workers)
+	for i := 0; i < p.workers; i++ {
+		go p.worker(ctx, i, jobs, results, &wg)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// worker drains jobs until the channel is closed or ctx is done. If
+// probeOne panics, the worker recovers and keeps running on the next job
+// instead of losing a slot in the pool permanently.
+func (p *ParserPool) worker(ctx context.Context, id int, jobs <-chan string, results chan<- Result, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		select {
+		case path, ok := <-jobs:
+			if !ok {
+				return
+			}
+			results <- p.probeOne(ctx, id, path)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *ParserPool) probeOne(ctx context.Context, workerID int, path string) (res Result) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("Recovered from panic while probing file", "path", path, "worker", workerID, "panic", r)
+			res = Result{Path: path, Err: fmt.Errorf("panic probing %s: %v", path, r)}
+		}
+	}()
+
+	probeCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	detail, err := p.parser.ParseDetailedContext(probeCtx, path)
+	return Result{Path: path, Detail: detail, Err: err}
+}
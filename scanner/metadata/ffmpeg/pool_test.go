@@ -0,0 +1,84 @@
+package ffmpeg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeProber returns a canned Detail for every file after an optional delay
+// (failing only for failFile), so ParserPool.Probe can be tested without
+// real ffprobe processes.
+type fakeProber struct {
+	delay    time.Duration
+	failFile string
+}
+
+func (f *fakeProber) ParseDetailedContext(ctx context.Context, file string) (*Detail, error) {
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if file == f.failFile {
+		return nil, errors.New("boom")
+	}
+	return &Detail{Format: Format{Tags: map[string][]string{"title": {file}}}}, nil
+}
+
+func TestParserPoolProbeReturnsAllResults(t *testing.T) {
+	files := []string{"a.mp3", "b.mp3", "c.mp3", "failing.mp3"}
+	pool := &ParserPool{parser: &fakeProber{failFile: "failing.mp3"}, workers: 2, timeout: time.Second}
+
+	results := pool.Probe(context.Background(), files)
+
+	seen := map[string]Result{}
+	for r := range results {
+		seen[r.Path] = r
+	}
+
+	if len(seen) != len(files) {
+		t.Fatalf("expected %d results, got %d: %v", len(files), len(seen), seen)
+	}
+	if seen["failing.mp3"].Err == nil {
+		t.Errorf("expected an error for failing.mp3, got none")
+	}
+	for _, f := range []string{"a.mp3", "b.mp3", "c.mp3"} {
+		if seen[f].Err != nil || seen[f].Detail == nil {
+			t.Errorf("expected %s to succeed, got %+v", f, seen[f])
+		}
+	}
+}
+
+func TestParserPoolProbeRespectsContextCancellation(t *testing.T) {
+	pool := &ParserPool{parser: &fakeProber{delay: time.Second}, workers: 1, timeout: 5 * time.Second}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := pool.Probe(ctx, []string{"a.mp3", "b.mp3", "c.mp3"})
+	cancel()
+
+	select {
+	case _, ok := <-results:
+		if ok {
+			// A result racing the cancellation is fine; draining further
+			// must still terminate once ctx is cancelled.
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("results channel did not produce or close promptly after cancellation")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for range results {
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("results channel never closed after context cancellation")
+	}
+}
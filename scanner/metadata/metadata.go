@@ -0,0 +1,197 @@
+// Package metadata defines the pluggable backend used by the scanner to
+// extract tags from media files. Concrete backends (ffmpeg, taglib, ...)
+// register themselves with Register and are tried in priority order, per
+// file extension. Preferring a native reader over ffmpeg buys more
+// reliable tag parsing for the formats it covers, not fewer ffprobe
+// invocations: see Extract's stream-info backfill, which still probes
+// every file a stream-info-less Reader (e.g. taglib) handles.
+package metadata
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/navidrome/navidrome/conf"
+	"github.com/navidrome/navidrome/log"
+)
+
+// ParsedTags is the set of tags extracted from a media file, keyed by
+// lowercase tag name. A key may hold several values, in the order they were
+// added; a Reader need not keep every value of a tag name that a file
+// repeats (taglib.Reader keeps only the first one it reads).
+type ParsedTags = map[string][]string
+
+// Reader extracts tags from media files. Implementations are registered
+// with Register and selected per file, in priority order.
+type Reader interface {
+	// Name identifies the backend, e.g. "taglib" or "ffmpeg". It is used to
+	// order backends via conf.Server.Scanner.Backends.
+	Name() string
+	// CanRead reports whether this Reader is able to parse the file at path,
+	// typically based on its extension.
+	CanRead(path string) bool
+	// Read parses tags from one or more files, returning the parsed tags
+	// keyed by the original path. Files that cannot be parsed are omitted
+	// from the result; a Reader may return an error when none of them could
+	// be parsed (ffmpeg.Parser does), which Extract logs and skips.
+	Read(paths ...string) (map[string]ParsedTags, error)
+	// HasStreamInfo reports whether Read's output includes stream-derived
+	// fields (duration, bitrate, channels, has_picture), as opposed to only
+	// container tag frames. Extract uses this to tell whether a file's
+	// chosen Reader needs a second pass through a Reader that does provide
+	// them, so a fast tag-only backend never silently drops duration.
+	HasStreamInfo() bool
+}
+
+// streamFields are the stream-derived keys Extract backfills from a
+// HasStreamInfo backend when the Reader chosen for a file doesn't supply
+// them itself.
+var streamFields = []string{"duration", "bitrate", "channels", "has_picture"}
+
+var readers []Reader
+
+// Register adds a Reader to the list of available backends. Call this from
+// an init() function in the backend's package.
+func Register(r Reader) {
+	readers = append(readers, r)
+}
+
+// defaultBackendOrder is the priority order used when
+// conf.Server.Scanner.Backends is empty, so a fresh install prefers the
+// native reader's tag parsing over the ffmpeg fallback without requiring
+// any configuration. It does not reduce how many files get probed with
+// ffprobe (see Extract); it only decides which backend's tags win. This
+// must not be inferred from package init order, which Go does not
+// guarantee across unrelated sibling packages.
+var defaultBackendOrder = []string{"taglib", "ffmpeg"}
+
+// orderedReaders returns the registered readers sorted by priority. The
+// order is taken from conf.Server.Scanner.Backends (a comma-separated list
+// of backend names, highest priority first) when set, falling back to
+// defaultBackendOrder otherwise. Readers not named in the order in use keep
+// their registration order and are tried last.
+func orderedReaders() []Reader {
+	order := defaultBackendOrder
+	if conf.Server.Scanner.Backends != "" {
+		order = strings.Split(conf.Server.Scanner.Backends, ",")
+	}
+
+	priority := map[string]int{}
+	for i, name := range order {
+		priority[strings.TrimSpace(name)] = i
+	}
+
+	ordered := make([]Reader, len(readers))
+	copy(ordered, readers)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		pi, oki := priority[ordered[i].Name()]
+		pj, okj := priority[ordered[j].Name()]
+		if oki && okj {
+			return pi < pj
+		}
+		return oki && !okj
+	})
+	return ordered
+}
+
+// readerFor returns the first available Reader willing to handle path.
+func readerFor(path string) Reader {
+	for _, r := range orderedReaders() {
+		if r.CanRead(path) {
+			return r
+		}
+	}
+	return nil
+}
+
+// Extract reads tags for the given paths, routing each file to the
+// highest-priority registered Reader willing to handle it, grouping files
+// by backend so each Reader is invoked once per batch. Files whose chosen
+// Reader doesn't supply stream-derived fields (e.g. taglib, which only
+// parses container tag frames and never computes duration) are backfilled
+// from a Reader that does, so picking a tag-only backend never costs the
+// scanner duration/bitrate/channels. This backfill is a second, full
+// ffprobe invocation per such file: it buys correctness (and taglib's more
+// reliable tag parsing), not a reduction in how many files get probed.
+func Extract(paths ...string) (map[string]ParsedTags, error) {
+	byReader := map[Reader][]string{}
+	var needStreamInfo []string
+	for _, path := range paths {
+		r := readerFor(path)
+		if r == nil {
+			log.Trace("No tag reader available for file", "path", path)
+			continue
+		}
+		byReader[r] = append(byReader[r], path)
+		if !r.HasStreamInfo() {
+			needStreamInfo = append(needStreamInfo, path)
+		}
+	}
+
+	result := map[string]ParsedTags{}
+	for r, files := range byReader {
+		tags, err := r.Read(files...)
+		if err != nil {
+			log.Warn("Error extracting tags", "reader", r.Name(), err)
+			continue
+		}
+		for file, t := range tags {
+			result[file] = t
+		}
+	}
+
+	backfillStreamInfo(result, needStreamInfo)
+	return result, nil
+}
+
+// backfillStreamInfo fills in streamFields for files whose chosen Reader
+// doesn't parse stream info itself, by re-reading them with the
+// highest-priority registered Reader that does.
+func backfillStreamInfo(result map[string]ParsedTags, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+
+	var supplement Reader
+	for _, r := range orderedReaders() {
+		if r.HasStreamInfo() {
+			supplement = r
+			break
+		}
+	}
+	if supplement == nil {
+		log.Warn("No backend available to supply stream info (duration, bitrate, ...)", "files", len(paths))
+		return
+	}
+
+	supplemental, err := supplement.Read(paths...)
+	if err != nil {
+		log.Warn("Error extracting stream info", "reader", supplement.Name(), err)
+		return
+	}
+	for path, tags := range supplemental {
+		dest, ok := result[path]
+		if !ok {
+			continue
+		}
+		for _, field := range streamFields {
+			if v, ok := tags[field]; ok {
+				dest[field] = v
+			}
+		}
+	}
+}
+
+// HasExtension reports whether path's extension (case-insensitive) matches
+// one of extensions. It is provided for Reader implementations to use in
+// their CanRead method.
+func HasExtension(path string, extensions ...string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
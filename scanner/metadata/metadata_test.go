@@ -0,0 +1,115 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/navidrome/navidrome/conf"
+)
+
+type fakeReader struct {
+	name          string
+	hasStreamInfo bool
+	tags          map[string]ParsedTags
+}
+
+func (r *fakeReader) Name() string             { return r.name }
+func (r *fakeReader) CanRead(path string) bool { return true }
+func (r *fakeReader) HasStreamInfo() bool      { return r.hasStreamInfo }
+func (r *fakeReader) Read(paths ...string) (map[string]ParsedTags, error) {
+	result := map[string]ParsedTags{}
+	for _, p := range paths {
+		if t, ok := r.tags[p]; ok {
+			result[p] = t
+		}
+	}
+	return result, nil
+}
+
+func TestOrderedReadersDefaultOrder(t *testing.T) {
+	saved := readers
+	savedBackends := conf.Server.Scanner.Backends
+	defer func() {
+		readers = saved
+		conf.Server.Scanner.Backends = savedBackends
+	}()
+
+	// Register in the "wrong" order, as would happen if ffmpeg's init() ran
+	// before taglib's: the default order must still put taglib first.
+	readers = nil
+	conf.Server.Scanner.Backends = ""
+	Register(&fakeReader{name: "ffmpeg"})
+	Register(&fakeReader{name: "taglib"})
+
+	ordered := orderedReaders()
+	if len(ordered) != 2 || ordered[0].Name() != "taglib" || ordered[1].Name() != "ffmpeg" {
+		t.Fatalf("expected [taglib ffmpeg] by default regardless of registration order, got %v", names(ordered))
+	}
+}
+
+func TestOrderedReadersRespectsConfig(t *testing.T) {
+	saved := readers
+	savedBackends := conf.Server.Scanner.Backends
+	defer func() {
+		readers = saved
+		conf.Server.Scanner.Backends = savedBackends
+	}()
+
+	readers = nil
+	Register(&fakeReader{name: "taglib"})
+	Register(&fakeReader{name: "ffmpeg"})
+	conf.Server.Scanner.Backends = "ffmpeg,taglib"
+
+	ordered := orderedReaders()
+	if len(ordered) != 2 || ordered[0].Name() != "ffmpeg" || ordered[1].Name() != "taglib" {
+		t.Fatalf("expected config order [ffmpeg taglib], got %v", names(ordered))
+	}
+}
+
+func TestExtractBackfillsStreamInfoFromAnotherReader(t *testing.T) {
+	saved := readers
+	savedBackends := conf.Server.Scanner.Backends
+	defer func() {
+		readers = saved
+		conf.Server.Scanner.Backends = savedBackends
+	}()
+
+	readers = nil
+	conf.Server.Scanner.Backends = "taglib,ffmpeg"
+	Register(&fakeReader{
+		name: "taglib",
+		tags: map[string]ParsedTags{
+			"song.mp3": {"title": {"Back In Black"}},
+		},
+	})
+	Register(&fakeReader{
+		name:          "ffmpeg",
+		hasStreamInfo: true,
+		tags: map[string]ParsedTags{
+			"song.mp3": {"duration": {"256.50"}, "bitrate": {"192"}, "title": {"wrong, should not overwrite"}},
+		},
+	})
+
+	result, err := Extract("song.mp3")
+	if err != nil {
+		t.Fatalf("Extract returned error: %v", err)
+	}
+
+	got := result["song.mp3"]
+	if v := got["title"]; len(v) != 1 || v[0] != "Back In Black" {
+		t.Errorf("title = %v, want taglib's value preserved", v)
+	}
+	if v := got["duration"]; len(v) != 1 || v[0] != "256.50" {
+		t.Errorf("duration = %v, want backfilled from ffmpeg", v)
+	}
+	if v := got["bitrate"]; len(v) != 1 || v[0] != "192" {
+		t.Errorf("bitrate = %v, want backfilled from ffmpeg", v)
+	}
+}
+
+func names(rs []Reader) []string {
+	out := make([]string, len(rs))
+	for i, r := range rs {
+		out[i] = r.Name()
+	}
+	return out
+}
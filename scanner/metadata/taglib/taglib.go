@@ -0,0 +1,156 @@
+// Package taglib implements metadata.Reader using dhowden/tag, a pure-Go
+// tag library that reads ID3v2, MP4, FLAC and Vorbis containers directly,
+// rather than parsing ffprobe's flattened JSON tag output. It trades the
+// breadth of ffmpeg.Parser (which can demux almost anything) for more
+// reliable multi-value and ReplayGain tags, and is tried first for the
+// formats it supports. It does not trade away ffprobe invocations: dhowden/tag
+// never computes duration, so metadata.Extract still probes every file this
+// package handles to backfill it (see metadata.Extract's stream-info
+// backfill) — taglib buys tag fidelity, not fewer ffprobe calls.
+package taglib
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dhowden/tag"
+	"github.com/navidrome/navidrome/log"
+	"github.com/navidrome/navidrome/scanner/metadata"
+)
+
+func init() {
+	metadata.Register(&Reader{})
+}
+
+type Reader struct{}
+
+var supportedExtensions = []string{".mp3", ".flac", ".ogg", ".oga", ".m4a", ".m4b", ".m4p", ".mp4"}
+
+func (r *Reader) Name() string { return "taglib" }
+
+func (r *Reader) CanRead(path string) bool {
+	return metadata.HasExtension(path, supportedExtensions...)
+}
+
+// HasStreamInfo is always false: dhowden/tag reads container tag frames
+// only, never stream info, so Extract backfills duration, bitrate,
+// channels and has_picture from another backend for files taglib handles.
+func (r *Reader) HasStreamInfo() bool { return false }
+
+func (r *Reader) Read(paths ...string) (map[string]metadata.ParsedTags, error) {
+	result := map[string]metadata.ParsedTags{}
+	for _, path := range paths {
+		tags, err := r.readFile(path)
+		if err != nil {
+			log.Trace("Error reading tags", "path", path, err)
+			continue
+		}
+		result[path] = tags
+	}
+	return result, nil
+}
+
+func (r *Reader) readFile(path string) (metadata.ParsedTags, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := tag.ReadFrom(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildTags(m), nil
+}
+
+// buildTags flattens a dhowden/tag Metadata into the parsedTags shape the
+// rest of the scanner expects. Split out from readFile so it can be tested
+// against a fake tag.Metadata without real media files.
+func buildTags(m tag.Metadata) metadata.ParsedTags {
+	tags := metadata.ParsedTags{}
+	add := func(name, value string) {
+		if value == "" {
+			return
+		}
+		tags[name] = append(tags[name], value)
+	}
+
+	add("title", m.Title())
+	add("album", m.Album())
+	add("artist", m.Artist())
+	add("albumartist", m.AlbumArtist())
+	add("composer", m.Composer())
+	add("genre", m.Genre())
+	if year := m.Year(); year != 0 {
+		add("date", strconv.Itoa(year))
+	}
+	if track, total := m.Track(); track != 0 {
+		add("track", strconv.Itoa(track))
+		if total != 0 {
+			add("tracktotal", strconv.Itoa(total))
+		}
+	}
+	if disc, total := m.Disc(); disc != 0 {
+		add("disc", strconv.Itoa(disc))
+		if total != 0 {
+			add("disctotal", strconv.Itoa(total))
+		}
+	}
+	if m.Picture() != nil {
+		add("has_picture", "true")
+	}
+	for k, v := range m.Raw() {
+		name := rawFrameSuffixRx.ReplaceAllString(k, "")
+		switch val := v.(type) {
+		case string:
+			key := strings.ToLower(name)
+			if _, ok := tags[key]; ok {
+				continue
+			}
+			add(key, val)
+		case *tag.Comm:
+			key := commKey(name, val)
+			if _, ok := tags[key]; ok {
+				continue
+			}
+			add(key, val.Text)
+		}
+	}
+
+	return tags
+}
+
+// rawFrameSuffixRx strips the "_N" suffix dhowden/tag appends to the raw
+// key of the 2nd and later occurrence of a repeated frame ID (see its
+// id3v2.go), so e.g. two TXXX frames ("TXXX", "TXXX_0") are both still
+// recognized as TXXX rather than the second silently falling through.
+var rawFrameSuffixRx = regexp.MustCompile(`_\d+$`)
+
+// commKey derives the tags key for an ID3v2 frame dhowden/tag decodes as
+// *tag.Comm: TXXX/WXXX (user-defined text/URL frames) and COMM/USLT
+// (comment/lyrics frames). TXXX's own Description (e.g.
+// "REPLAYGAIN_TRACK_GAIN") is the real tag name, not the generic frame ID,
+// and using it is what actually preserves multiple same-frame-ID TXXX tags
+// as distinct values rather than collapsing them. USLT is keyed to match
+// ffmpeg.Parser's "lyrics"/"lyrics-<lang>" convention so both backends'
+// output lands in the same place for synced-lyrics detection.
+func commKey(frameID string, c *tag.Comm) string {
+	switch frameID {
+	case "TXXX", "TXX", "WXXX", "WXX":
+		if c.Description != "" {
+			return strings.ToLower(c.Description)
+		}
+		return strings.ToLower(frameID)
+	case "USLT", "ULT":
+		if lang := strings.ToLower(c.Language); lang != "" && lang != "und" && lang != "xxx" {
+			return "lyrics-" + lang
+		}
+		return "lyrics"
+	default: // COMM, COM
+		return "comment"
+	}
+}
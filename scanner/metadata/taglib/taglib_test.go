@@ -0,0 +1,112 @@
+package taglib
+
+import (
+	"testing"
+
+	"github.com/dhowden/tag"
+)
+
+// fakeMetadata implements tag.Metadata with fixed values, so buildTags can
+// be tested without a real media file.
+type fakeMetadata struct {
+	title, album, artist, albumArtist, composer, genre string
+	year                                               int
+	track, trackTotal                                  int
+	disc, discTotal                                    int
+	picture                                            *tag.Picture
+	raw                                                map[string]interface{}
+}
+
+var _ tag.Metadata = (*fakeMetadata)(nil)
+
+func (f *fakeMetadata) Format() tag.Format          { return "" }
+func (f *fakeMetadata) FileType() tag.FileType      { return "" }
+func (f *fakeMetadata) Title() string               { return f.title }
+func (f *fakeMetadata) Album() string               { return f.album }
+func (f *fakeMetadata) Artist() string              { return f.artist }
+func (f *fakeMetadata) AlbumArtist() string         { return f.albumArtist }
+func (f *fakeMetadata) Composer() string            { return f.composer }
+func (f *fakeMetadata) Genre() string               { return f.genre }
+func (f *fakeMetadata) Year() int                   { return f.year }
+func (f *fakeMetadata) Track() (int, int)           { return f.track, f.trackTotal }
+func (f *fakeMetadata) Disc() (int, int)            { return f.disc, f.discTotal }
+func (f *fakeMetadata) Picture() *tag.Picture       { return f.picture }
+func (f *fakeMetadata) Lyrics() string              { return "" }
+func (f *fakeMetadata) Comment() string             { return "" }
+func (f *fakeMetadata) Raw() map[string]interface{} { return f.raw }
+
+func TestBuildTags(t *testing.T) {
+	m := &fakeMetadata{
+		title:       "Back In Black",
+		album:       "Back In Black",
+		artist:      "AC/DC",
+		albumArtist: "AC/DC",
+		genre:       "Rock",
+		year:        1980,
+		track:       1, trackTotal: 10,
+		disc: 1, discTotal: 1,
+		picture: &tag.Picture{Data: []byte{0x01}},
+		raw: map[string]interface{}{
+			// dhowden/tag decodes TXXX/COMM/USLT frames as *tag.Comm, not
+			// string, and suffixes the raw key of the 2nd+ occurrence of a
+			// repeated frame ID with "_N" (see id3v2.go).
+			"TXXX":   &tag.Comm{Description: "REPLAYGAIN_TRACK_GAIN", Text: "-6.4 dB"},
+			"TXXX_0": &tag.Comm{Description: "REPLAYGAIN_ALBUM_GAIN", Text: "-7.2 dB"},
+			"USLT":   &tag.Comm{Language: "eng", Text: "plain lyrics"},
+		},
+	}
+
+	tags := buildTags(m)
+
+	want := map[string]string{
+		"title":                 "Back In Black",
+		"album":                 "Back In Black",
+		"artist":                "AC/DC",
+		"albumartist":           "AC/DC",
+		"genre":                 "Rock",
+		"date":                  "1980",
+		"track":                 "1",
+		"tracktotal":            "10",
+		"disc":                  "1",
+		"disctotal":             "1",
+		"has_picture":           "true",
+		"replaygain_track_gain": "-6.4 dB",
+		"replaygain_album_gain": "-7.2 dB",
+		"lyrics-eng":            "plain lyrics",
+	}
+	for k, v := range want {
+		if got := tags[k]; len(got) != 1 || got[0] != v {
+			t.Errorf("tags[%q] = %v, want [%q]", k, got, v)
+		}
+	}
+}
+
+func TestBuildTagsOmitsZeroValues(t *testing.T) {
+	tags := buildTags(&fakeMetadata{})
+	for _, k := range []string{"title", "track", "disc", "date", "has_picture"} {
+		if _, ok := tags[k]; ok {
+			t.Errorf("expected no %q tag for empty metadata, got %v", k, tags[k])
+		}
+	}
+}
+
+func TestCommKey(t *testing.T) {
+	cases := []struct {
+		frameID string
+		c       *tag.Comm
+		want    string
+	}{
+		{"TXXX", &tag.Comm{Description: "REPLAYGAIN_TRACK_GAIN"}, "replaygain_track_gain"},
+		{"TXXX_0", &tag.Comm{Description: "MusicBrainz Track Id"}, "musicbrainz track id"},
+		{"TXXX", &tag.Comm{}, "txxx"},
+		{"USLT", &tag.Comm{Language: "fra"}, "lyrics-fra"},
+		{"USLT", &tag.Comm{Language: "und"}, "lyrics"},
+		{"USLT", &tag.Comm{}, "lyrics"},
+		{"COMM", &tag.Comm{Language: "eng"}, "comment"},
+	}
+	for _, c := range cases {
+		if got := commKey(rawFrameSuffixRx.ReplaceAllString(c.frameID, ""), c.c); got != c.want {
+			t.Errorf("commKey(%q, %+v) = %q, want %q", c.frameID, c.c, got, c.want)
+		}
+	}
+}